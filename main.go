@@ -1,7 +1,8 @@
 // -----
-// xkcd.go
+// main.go
 //
-// A program for indexing all existing xkcd comics, and allowing the CLI user to search them by keyword.
+// CLI entry point: parses flags and arguments and dispatches to the xkcd
+// package, which holds all of the actual indexing/search/fetch logic.
 //
 // Author: Kawai Washburn <kawaiwashburn@gmail.com>
 // -----
@@ -9,62 +10,53 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
-	"strings"
-)
 
-const xkcdURL = "https://xkcd.com/"
-const xkcdSuffix = "info.0.json"
-const indexPath = "./comix.dat"
-
-type comic struct {
-	Month      string
-	Num        int
-	Link       string
-	Year       string
-	News       string
-	SafeTitle  string `json:"safe_title"`
-	Transcript string
-	Alt        string
-	Img        string
-	Title      string
-	Day        string
-}
+	"kawaiian/xkcd-serial/xkcd"
+)
 
-type comicIdx struct {
-	idx map[string]comic
-}
+var workers = flag.Int("workers", 8, "number of concurrent workers to use when indexing comics")
+var storeKind = flag.String("store", "json", "storage backend for the comic index: json or bin")
+var downloadDir = flag.String("download", "", "if set, save the comic's image into this directory")
+var sixel = flag.Bool("sixel", false, "render the comic's image inline via sixel, for compatible terminals")
+var explainFetch = flag.Bool("fetch-explanation", false, "for explain, also fetch and print the wiki page's Explanation section")
 
 func main() {
-	args, err := getArgs()
+	flag.Parse()
 
+	args, err := getArgs()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	comIdx, err := loadIdx()
+	store, err := xkcd.OpenStore(*storeKind)
 	if err != nil {
-		log.Fatalf("Unable to load index from file: %s", err)
+		log.Fatalf("Unable to open %s store: %s", *storeKind, err)
 	}
 
+	idx := xkcd.NewIndex(store)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	comm := args[0]
 	switch comm {
 	case "index":
 		log.Printf("the current command is %s with last index %s\n", comm, args[1])
 		// TODO: Break apart the current logic to determine the request index and the actual request
-		getComics(args[1], &comIdx)
+		xkcd.GetComics(ctx, args[1], idx, *workers)
 	case "search":
 		log.Printf("the current command is %s with url %s\n", comm, args[1])
 		phrase := args[1]
 
-		cList, err := comIdx.search(phrase)
+		cList, err := idx.Search(phrase)
 		if err != nil {
 			log.Printf("Error while searching for comic: %s", err)
 		}
@@ -76,159 +68,106 @@ func main() {
 		for _, cmc := range cList {
 			fmt.Printf("Found '%s' in comic %v, with transcript:\n \"%s\"\n\n", phrase, cmc.Num, cmc.Transcript)
 		}
-	}
-
-	err = dumpIdx(&comIdx)
-	if err != nil {
-		log.Fatalf("Error writing index to disk: %v", err)
-	}
-}
-
-func getArgs() ([]string, error) {
-	args := os.Args[1:]
-
-	if len(args) > 2 {
-		return nil, errors.New("too many arguments supplied")
-	} else if args[0] == "index" {
-		if len(args) == 1 {
-			args = append(args, "1")
-		} else {
-			if args[1] != "all" {
-				i, err := strconv.Atoi(args[1])
-				if err != nil {
-					log.Fatalf("invalid value for index: %v", args[1])
-				}
-				if i < 0 {
-					args[1] = "1"
-				}
-			}
+	case "migrate":
+		log.Printf("Migrating %s store into %s store", *storeKind, args[1])
+		if err := xkcd.MigrateStore(idx, args[1]); err != nil {
+			log.Fatalf("Unable to migrate store: %s", err)
+		}
+	case "get":
+		num, err := strconv.Atoi(args[1])
+		if err != nil {
+			log.Fatalf("invalid comic number: %v", args[1])
 		}
-	}
-
-	return args, nil
-}
-
-func loadIdx() (comicIdx, error) {
-	cIdx := comicIdx{idx: make(map[string]comic)}
-	b, err := ioutil.ReadFile(indexPath)
-	if err != nil {
-		return cIdx, errors.New("error opening index from disk at" + indexPath)
-	}
-
-	if err := json.Unmarshal(b, &cIdx.idx); err != nil {
-		return cIdx, errors.New("error loading index from disk at" + indexPath)
-	}
 
-	return cIdx, nil
-}
+		cmc, err := xkcd.Get(idx, num)
+		if err != nil {
+			log.Fatalf("Unable to get comic: %s", err)
+		}
+		printComic(cmc)
+	case "random":
+		cmc, err := xkcd.Random(idx)
+		if err != nil {
+			log.Fatalf("Unable to pick a random comic: %s", err)
+		}
+		printComic(cmc)
+	case "explain":
+		num, err := strconv.Atoi(args[1])
+		if err != nil {
+			log.Fatalf("invalid comic number: %v", args[1])
+		}
 
-func dumpIdx(cIdx *comicIdx) error {
-	idx, err := json.Marshal(cIdx.idx)
-	if err != nil {
-		return fmt.Errorf("Unable to encode comic index: %s", err)
+		explanation, err := xkcd.Explain(num, *explainFetch)
+		if err != nil {
+			log.Printf("Error while explaining comic: %s", err)
+		}
+		fmt.Println(explanation)
 	}
 
-	err = ioutil.WriteFile(indexPath, idx, 0644)
-	if err != nil {
-		return fmt.Errorf("Unable to flush index to disk: %s", err)
+	if err := idx.Close(); err != nil {
+		log.Fatalf("Error writing index to disk: %v", err)
 	}
-
-	return nil
 }
 
-// TODO: This is serial, and inefficient
-func getComics(idx string, cIdx *comicIdx) {
-	var n int
+// printComic prints a comic's metadata and handles the -download/-sixel
+// flags against its image.
+func printComic(cmc xkcd.Comic) {
+	fmt.Printf("#%v: %s\n%s\n\n%s\n", cmc.Num, cmc.Title, cmc.Link, cmc.Alt)
 
-	// TODO: Take this section that calculates the index and place it in its own code
-	latest, err := getLatest()
-	if err != nil {
-		log.Fatalf("Unable to get latest xkcd comic number: %s", err)
-	}
-
-	if idx != "all" {
-		n, err = strconv.Atoi(idx)
+	var imgPath string
+	if *downloadDir != "" {
+		path, err := xkcd.Download(cmc, *downloadDir)
 		if err != nil {
-			log.Fatalf("invalid value for index: %v", n)
+			log.Printf("Unable to download image: %s", err)
+		} else {
+			log.Printf("Saved image to %s", path)
+			imgPath = path
 		}
-		n = n - 1
-	} else {
-		n = latest
 	}
-	// TODO: See note above
 
-	for i := latest; i >= latest-n; i-- {
-		log.Printf("Getting comic %v...", i)
-		cNum := strconv.Itoa(n)
-
-		if _, present := cIdx.idx[cNum]; !present {
-			current, err := getXkcdComic(i)
+	if *sixel {
+		if imgPath == "" {
+			path, err := xkcd.Download(cmc, os.TempDir())
 			if err != nil {
-				log.Printf("Unable to get xkcd comic: %s", err)
-			} else {
-				log.Printf("Got comic %v", current.Num)
-				cIdx.indexComic(current)
+				log.Printf("Unable to fetch image for sixel rendering: %s", err)
+				return
 			}
-		} else {
-			log.Printf("Comic already indexed.")
+			imgPath = path
+			defer os.Remove(imgPath)
+		}
+		if err := xkcd.RenderSixel(imgPath); err != nil {
+			log.Printf("Unable to render image as sixel: %s", err)
 		}
 	}
 }
 
-func getLatest() (int, error) {
-	latest, err := getXkcdComic(0)
-	if err != nil {
-		return -1, err
-	}
-
-	log.Printf("Latest comic number is %v", latest.Num)
-	return latest.Num, nil
-}
-
-func getXkcdComic(idx int) (comic, error) {
-	var cNum string
-
-	if idx == 0 {
-		cNum = ""
-	} else {
-		cNum = strconv.Itoa(idx)
-	}
-
-	resp, err := http.Get(xkcdURL + cNum + "/" + xkcdSuffix)
-
-	if err != nil {
-		return comic{}, fmt.Errorf("could not get xkcd info from remote")
-	} else if resp.StatusCode != http.StatusOK {
-		resp.Body.Close()
-		return comic{}, fmt.Errorf("error in request to xcd: %s", resp.Status)
-	}
-
-	var current comic
+func getArgs() ([]string, error) {
+	args := flag.Args()
 
-	if err := json.NewDecoder(resp.Body).Decode(&current); err != nil {
-		return comic{}, fmt.Errorf("unable to decode json value from xkcd: %s", err)
+	if len(args) == 0 {
+		return nil, errors.New("no command supplied")
 	}
-
-	return current, nil
-}
-
-func (cIdx *comicIdx) indexComic(cmc comic) {
-	cNum := strconv.Itoa(cmc.Num)
-
-	if _, present := cIdx.idx[cNum]; !present {
-		cIdx.idx[cNum] = cmc
-		log.Printf("Indexed comic %v:", cNum)
+	if len(args) > 2 {
+		return nil, errors.New("too many arguments supplied")
 	}
-}
-
-func (cIdx *comicIdx) search(phrase string) ([]comic, error) {
-	var cList []comic
 
-	for _, cmc := range cIdx.idx {
-		if strings.Contains(cmc.Transcript, phrase) {
-			cList = append(cList, cmc)
+	switch args[0] {
+	case "index":
+		if len(args) == 1 {
+			args = append(args, "1")
+		} else if args[1] != "all" {
+			i, err := strconv.Atoi(args[1])
+			if err != nil {
+				log.Fatalf("invalid value for index: %v", args[1])
+			}
+			if i < 0 {
+				args[1] = "1"
+			}
+		}
+	case "search", "get", "explain", "migrate":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("%q requires an argument", args[0])
 		}
 	}
 
-	return cList, nil
+	return args, nil
 }
@@ -0,0 +1,262 @@
+// -----
+// binstore.go
+//
+// An append-only binary store: each comic is written as a length-prefixed
+// JSON record, so indexing a new comic is an O(1) append instead of a full
+// rewrite. A small trailer at the very end of the file records each
+// comic's byte offset; it's stripped on open and rewritten on Close so
+// mid-session appends never have to touch it. If the process never got to
+// Close (killed, crashed) there's no trailer to read, so open instead
+// recovers the offset table by scanning the length-prefixed records
+// directly -- see loadTrailer and scanRecords.
+// -----
+
+package xkcd
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"sync"
+)
+
+type binStore struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	offsets map[int]int64
+}
+
+func openBinStore(path string) (*binStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open store file %s: %s", path, err)
+	}
+
+	bs := &binStore{path: path, f: f, offsets: make(map[int]int64)}
+	if err := bs.loadTrailer(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return bs, nil
+}
+
+// loadTrailer reads the offset table from the end of the file, if present
+// and well-formed, and truncates it off so that subsequent writes are
+// plain appends. When the trailer is missing or corrupt -- the process
+// never reached Close -- it falls back to scanRecords, which rebuilds the
+// same offset table by walking the records themselves, so a kill -9 or
+// crash only costs the last partially-written record instead of the
+// whole file.
+func (bs *binStore) loadTrailer() error {
+	info, err := bs.f.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to stat store file: %s", err)
+	}
+
+	size := info.Size()
+	if size == 0 {
+		return nil
+	}
+
+	if offsets, trailerStart, ok := bs.readTrailer(size); ok {
+		bs.offsets = offsets
+		return bs.f.Truncate(trailerStart)
+	}
+
+	offsets, dataEnd, err := bs.scanRecords(size)
+	if err != nil {
+		return err
+	}
+	bs.offsets = offsets
+	return bs.f.Truncate(dataEnd)
+}
+
+// readTrailer attempts to parse the offset table a clean Close would have
+// written at the end of the file. It reports ok=false, rather than an
+// error, for anything that doesn't look like a well-formed trailer, so
+// the caller can fall back to scanRecords instead of failing to open.
+func (bs *binStore) readTrailer(size int64) (offsets map[int]int64, trailerStart int64, ok bool) {
+	if size < 8 {
+		return nil, 0, false
+	}
+
+	var lenBuf [8]byte
+	if _, err := bs.f.ReadAt(lenBuf[:], size-8); err != nil {
+		return nil, 0, false
+	}
+	trailerLen := int64(binary.BigEndian.Uint64(lenBuf[:]))
+
+	trailerStart = size - 8 - trailerLen
+	if trailerLen < 0 || trailerStart < 0 {
+		return nil, 0, false
+	}
+
+	trailer := make([]byte, trailerLen)
+	if _, err := bs.f.ReadAt(trailer, trailerStart); err != nil {
+		return nil, 0, false
+	}
+
+	if err := json.Unmarshal(trailer, &offsets); err != nil {
+		return nil, 0, false
+	}
+
+	return offsets, trailerStart, true
+}
+
+// scanRecords rebuilds the offset table by walking the length-prefixed
+// records from the front of the file, for when no well-formed trailer was
+// found. It stops at the first record whose header or body doesn't fully
+// fit within size -- a torn write from an append that was interrupted
+// mid-write -- and returns the offset where the good data ends, so the
+// caller can truncate the torn remainder away.
+func (bs *binStore) scanRecords(size int64) (map[int]int64, int64, error) {
+	offsets := make(map[int]int64)
+
+	var offset int64
+	for offset+4 <= size {
+		var lenBuf [4]byte
+		if _, err := bs.f.ReadAt(lenBuf[:], offset); err != nil {
+			break
+		}
+		recLen := int64(binary.BigEndian.Uint32(lenBuf[:]))
+
+		recEnd := offset + 4 + recLen
+		if recEnd > size {
+			break
+		}
+
+		data := make([]byte, recLen)
+		if _, err := bs.f.ReadAt(data, offset+4); err != nil {
+			break
+		}
+
+		var cmc Comic
+		if err := json.Unmarshal(data, &cmc); err != nil {
+			break
+		}
+
+		offsets[cmc.Num] = offset
+		offset = recEnd
+	}
+
+	return offsets, offset, nil
+}
+
+func (bs *binStore) Path() string {
+	return bs.path
+}
+
+func (bs *binStore) Get(num int) (Comic, bool, error) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	offset, present := bs.offsets[num]
+	if !present {
+		return Comic{}, false, nil
+	}
+
+	cmc, err := bs.readRecordAt(offset)
+	if err != nil {
+		return Comic{}, false, err
+	}
+	return cmc, true, nil
+}
+
+func (bs *binStore) readRecordAt(offset int64) (Comic, error) {
+	var lenBuf [4]byte
+	if _, err := bs.f.ReadAt(lenBuf[:], offset); err != nil {
+		return Comic{}, fmt.Errorf("unable to read record header: %s", err)
+	}
+	recLen := binary.BigEndian.Uint32(lenBuf[:])
+
+	data := make([]byte, recLen)
+	if _, err := bs.f.ReadAt(data, offset+4); err != nil {
+		return Comic{}, fmt.Errorf("unable to read record: %s", err)
+	}
+
+	var cmc Comic
+	if err := json.Unmarshal(data, &cmc); err != nil {
+		return Comic{}, fmt.Errorf("unable to decode record: %s", err)
+	}
+	return cmc, nil
+}
+
+func (bs *binStore) Put(cmc Comic) error {
+	data, err := json.Marshal(cmc)
+	if err != nil {
+		return fmt.Errorf("unable to encode comic %v: %s", cmc.Num, err)
+	}
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	offset, err := bs.f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("unable to seek store file: %s", err)
+	}
+
+	var lenBuf [4]byte
+	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(data)))
+	if _, err := bs.f.Write(lenBuf[:]); err != nil {
+		return fmt.Errorf("unable to write record header: %s", err)
+	}
+	if _, err := bs.f.Write(data); err != nil {
+		return fmt.Errorf("unable to write record: %s", err)
+	}
+
+	bs.offsets[cmc.Num] = offset
+	return nil
+}
+
+func (bs *binStore) Iter() iter.Seq[Comic] {
+	bs.mu.Lock()
+	nums := make([]int, 0, len(bs.offsets))
+	for num := range bs.offsets {
+		nums = append(nums, num)
+	}
+	bs.mu.Unlock()
+
+	return func(yield func(Comic) bool) {
+		for _, num := range nums {
+			cmc, present, err := bs.Get(num)
+			if err != nil || !present {
+				continue
+			}
+			if !yield(cmc) {
+				return
+			}
+		}
+	}
+}
+
+// Close writes a fresh trailer recording every comic's offset and closes
+// the file.
+func (bs *binStore) Close() error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	trailer, err := json.Marshal(bs.offsets)
+	if err != nil {
+		return fmt.Errorf("unable to encode store trailer: %s", err)
+	}
+
+	if _, err := bs.f.Seek(0, io.SeekEnd); err != nil {
+		return fmt.Errorf("unable to seek store file: %s", err)
+	}
+	if _, err := bs.f.Write(trailer); err != nil {
+		return fmt.Errorf("unable to write store trailer: %s", err)
+	}
+
+	var lenBuf [8]byte
+	binary.BigEndian.PutUint64(lenBuf[:], uint64(len(trailer)))
+	if _, err := bs.f.Write(lenBuf[:]); err != nil {
+		return fmt.Errorf("unable to write store trailer length: %s", err)
+	}
+
+	return bs.f.Close()
+}
@@ -0,0 +1,94 @@
+// -----
+// commands.go
+//
+// Read-oriented lookups used by the get/random/explain subcommands: Get
+// fetches a single comic (indexing it if needed), Random picks one from
+// what's already indexed, and Explain points at its explainxkcd.com entry.
+// -----
+
+package xkcd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"regexp"
+	"strconv"
+)
+
+// explainURL is a var, not a const, so tests can point it at an
+// httptest.Server instead of the real site.
+var explainURL = "https://www.explainxkcd.com/wiki/index.php/"
+
+// Get returns the comic numbered num, fetching and indexing it first if
+// it isn't already in ix.
+func Get(ix *Index, num int) (Comic, error) {
+	cNum := strconv.Itoa(num)
+
+	ix.mu.Lock()
+	cmc, present := ix.idx[cNum]
+	ix.mu.Unlock()
+	if present {
+		return cmc, nil
+	}
+
+	cmc, err := getComic(context.Background(), num)
+	if err != nil {
+		return Comic{}, fmt.Errorf("unable to get comic %v: %s", num, err)
+	}
+
+	ix.indexComic(cmc)
+	return cmc, nil
+}
+
+// Random returns a uniformly random comic from what's currently indexed.
+func Random(ix *Index) (Comic, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if len(ix.idx) == 0 {
+		return Comic{}, fmt.Errorf("no comics are indexed yet")
+	}
+
+	n := rand.Intn(len(ix.idx))
+	for _, cmc := range ix.idx {
+		if n == 0 {
+			return cmc, nil
+		}
+		n--
+	}
+
+	panic("unreachable")
+}
+
+var explainSectionRe = regexp.MustCompile(`(?is)<span[^>]*id="Explanation"[^>]*>.*?</span>(.*?)<h2`)
+var tagRe = regexp.MustCompile(`(?s)<[^>]*>`)
+
+// Explain returns the explainxkcd.com URL for comic num, and, if
+// fetchExplanation is true, the text of that page's Explanation section.
+func Explain(num int, fetchExplanation bool) (string, error) {
+	url := explainURL + strconv.Itoa(num)
+	if !fetchExplanation {
+		return url, nil
+	}
+
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return url, fmt.Errorf("unable to fetch explanation page: %s", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return url, fmt.Errorf("unable to read explanation page: %s", err)
+	}
+
+	match := explainSectionRe.FindSubmatch(body)
+	if match == nil {
+		return url, fmt.Errorf("could not find an Explanation section on %s", url)
+	}
+
+	explanation := tagRe.ReplaceAllString(string(match[1]), "")
+	return url + "\n\n" + explanation, nil
+}
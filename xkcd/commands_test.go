@@ -0,0 +1,105 @@
+package xkcd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetReturnsAlreadyIndexedComicWithoutFetching(t *testing.T) {
+	ix := newTestIndex(Comic{Num: 1, Title: "Barrel - Part 1"})
+
+	cmc, err := Get(ix, 1)
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	if cmc.Title != "Barrel - Part 1" {
+		t.Fatalf("got title %q, want %q", cmc.Title, "Barrel - Part 1")
+	}
+}
+
+func TestRandomPicksAnIndexedComic(t *testing.T) {
+	ix := newTestIndex(Comic{Num: 1}, Comic{Num: 2}, Comic{Num: 3})
+
+	seen := make(map[int]bool)
+	for i := 0; i < 50; i++ {
+		cmc, err := Random(ix)
+		if err != nil {
+			t.Fatalf("Random: %s", err)
+		}
+		seen[cmc.Num] = true
+	}
+
+	for _, num := range []int{1, 2, 3} {
+		if !seen[num] {
+			t.Errorf("comic %v was never returned by Random across 50 draws", num)
+		}
+	}
+}
+
+func TestRandomErrorsWhenEmpty(t *testing.T) {
+	ix := newTestIndex()
+
+	if _, err := Random(ix); err == nil {
+		t.Fatal("expected an error when no comics are indexed")
+	}
+}
+
+func TestExplainWithoutFetchReturnsURLOnly(t *testing.T) {
+	explanation, err := Explain(1000, false)
+	if err != nil {
+		t.Fatalf("Explain: %s", err)
+	}
+	want := explainURL + "1000"
+	if explanation != want {
+		t.Fatalf("got %q, want %q", explanation, want)
+	}
+}
+
+func TestExplainFetchesAndStripsTags(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body>
+			<h2>Summary</h2>
+			<p>not the section we want</p>
+			<span class="mw-headline" id="Explanation">Explanation</span>
+			<p>This comic is about <b>barrels</b>.</p>
+			<h2>Transcript</h2>
+			<p>irrelevant</p>
+		</body></html>`))
+	}))
+	defer srv.Close()
+
+	old := explainURL
+	explainURL = srv.URL + "/"
+	defer func() { explainURL = old }()
+
+	explanation, err := Explain(1000, true)
+	if err != nil {
+		t.Fatalf("Explain: %s", err)
+	}
+	if !strings.Contains(explanation, "This comic is about barrels.") {
+		t.Fatalf("explanation missing expected text, got: %q", explanation)
+	}
+	if strings.Contains(explanation, "<") {
+		t.Fatalf("explanation still contains HTML tags: %q", explanation)
+	}
+	if strings.Contains(explanation, "irrelevant") {
+		t.Fatalf("explanation bled past the Explanation section into Transcript: %q", explanation)
+	}
+}
+
+func TestExplainErrorsWhenNoExplanationSection(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><h2>Transcript</h2><p>no explanation here</p></body></html>`))
+	}))
+	defer srv.Close()
+
+	old := explainURL
+	explainURL = srv.URL + "/"
+	defer func() { explainURL = old }()
+
+	if _, err := Explain(1000, true); err == nil {
+		t.Fatal("expected an error when no Explanation section is present")
+	}
+}
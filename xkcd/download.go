@@ -0,0 +1,94 @@
+// -----
+// download.go
+//
+// Saves a comic's image to disk, preferring the "_large" variant xkcd
+// publishes for some comics when it's available.
+// -----
+
+package xkcd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// xkcdImgHost is a var, not a const, so tests can point it at an
+// httptest.Server's host instead of the real site.
+var xkcdImgHost = "imgs.xkcd.com"
+
+// Download saves cmc's image into dir, upgrading to the "_large" variant
+// when Img is hosted on xkcd.com and a larger version exists. It returns
+// the path the image was saved to.
+func Download(cmc Comic, dir string) (string, error) {
+	if cmc.Img == "" {
+		return "", fmt.Errorf("comic %v has no image", cmc.Num)
+	}
+
+	imgURL := largeVariant(cmc.Img)
+
+	resp, err := httpClient.Get(imgURL)
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch image: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error fetching image: %s", resp.Status)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("unable to create download directory: %s", err)
+	}
+
+	name := fmt.Sprintf("%v-%s", cmc.Num, path.Base(imgURL))
+	dest := filepath.Join(dir, name)
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return "", fmt.Errorf("unable to create image file: %s", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		return "", fmt.Errorf("unable to write image file: %s", err)
+	}
+
+	return dest, nil
+}
+
+// largeVariant upgrades imgURL to its "_large" counterpart (e.g.
+// https://imgs.xkcd.com/comics/foo.png -> foo_large.png) when imgURL is
+// hosted on xkcd.com and the larger version exists, falling back to
+// imgURL itself otherwise.
+func largeVariant(imgURL string) string {
+	u, err := url.Parse(imgURL)
+	if err != nil || u.Host != xkcdImgHost {
+		return imgURL
+	}
+
+	ext := path.Ext(u.Path)
+	if ext == "" || strings.HasSuffix(strings.TrimSuffix(u.Path, ext), "_large") {
+		return imgURL
+	}
+
+	large := *u
+	large.Path = strings.TrimSuffix(u.Path, ext) + "_large" + ext
+
+	resp, err := httpClient.Head(large.String())
+	if err != nil {
+		return imgURL
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return imgURL
+	}
+
+	return large.String()
+}
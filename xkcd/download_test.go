@@ -0,0 +1,99 @@
+package xkcd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadSavesImageToDir(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fake png bytes"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cmc := Comic{Num: 1000, Img: srv.URL + "/comics/barrel.png"}
+
+	path, err := Download(cmc, dir)
+	if err != nil {
+		t.Fatalf("Download: %s", err)
+	}
+	if filepath.Dir(path) != dir {
+		t.Fatalf("saved to %q, want it inside %q", path, dir)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading saved image: %s", err)
+	}
+	if string(data) != "fake png bytes" {
+		t.Fatalf("saved image contents = %q, want %q", data, "fake png bytes")
+	}
+}
+
+func TestDownloadErrorsWithNoImage(t *testing.T) {
+	if _, err := Download(Comic{Num: 1}, t.TempDir()); err == nil {
+		t.Fatal("expected an error for a comic with no image")
+	}
+}
+
+func TestLargeVariantUpgradesWhenAvailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/comics/barrel_large.png" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	old := xkcdImgHost
+	xkcdImgHost = u.Host
+	defer func() { xkcdImgHost = old }()
+
+	got := largeVariant(srv.URL + "/comics/barrel.png")
+	want := srv.URL + "/comics/barrel_large.png"
+	if got != want {
+		t.Fatalf("largeVariant = %q, want %q", got, want)
+	}
+}
+
+func TestLargeVariantFallsBackWhenNotAvailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	old := xkcdImgHost
+	xkcdImgHost = u.Host
+	defer func() { xkcdImgHost = old }()
+
+	orig := srv.URL + "/comics/barrel.png"
+	if got := largeVariant(orig); got != orig {
+		t.Fatalf("largeVariant = %q, want unchanged %q", got, orig)
+	}
+}
+
+func TestLargeVariantSkipsNonXkcdHosts(t *testing.T) {
+	orig := "https://example.com/comics/barrel.png"
+	if got := largeVariant(orig); got != orig {
+		t.Fatalf("largeVariant = %q, want unchanged %q", got, orig)
+	}
+}
+
+func TestLargeVariantSkipsAlreadyLargeImages(t *testing.T) {
+	old := xkcdImgHost
+	xkcdImgHost = "imgs.xkcd.com"
+	defer func() { xkcdImgHost = old }()
+
+	orig := "https://imgs.xkcd.com/comics/barrel_large.png"
+	if got := largeVariant(orig); got != orig {
+		t.Fatalf("largeVariant = %q, want unchanged %q", got, orig)
+	}
+}
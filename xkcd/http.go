@@ -0,0 +1,23 @@
+// -----
+// http.go
+//
+// The http.Client shared by every outbound request this package makes, so
+// a stalled remote connection can't hang a fetch (or a worker ignoring
+// Ctrl-C) forever.
+// -----
+
+package xkcd
+
+import (
+	"net/http"
+	"time"
+)
+
+// httpClient is used in place of http.DefaultClient/http.Get/http.Head
+// throughout the package. Its timeout bounds the worst case for a single
+// request; callers that have a context.Context available (getComic, via
+// GetComics) also thread it through so cancellation interrupts an
+// in-flight request immediately instead of waiting out the timeout.
+var httpClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
@@ -0,0 +1,108 @@
+// -----
+// jsonstore.go
+//
+// The original comix.dat format, kept for compatibility: the whole index
+// is held in memory and re-marshaled as one JSON blob on flush. Put
+// batches up to flushEvery writes before paying for a full rewrite, which
+// keeps "index all" from rewriting an ever-growing file on every comic.
+// -----
+
+package xkcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"iter"
+	"os"
+	"strconv"
+	"sync"
+)
+
+type jsonStore struct {
+	mu    sync.Mutex
+	path  string
+	idx   map[string]Comic
+	dirty int
+}
+
+func openJSONStore(path string) (*jsonStore, error) {
+	js := &jsonStore{path: path, idx: make(map[string]Comic)}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return js, nil
+		}
+		return nil, fmt.Errorf("error opening index from disk at %s: %s", path, err)
+	}
+
+	if err := json.Unmarshal(b, &js.idx); err != nil {
+		return nil, fmt.Errorf("error loading index from disk at %s: %s", path, err)
+	}
+
+	return js, nil
+}
+
+func (js *jsonStore) Path() string {
+	return js.path
+}
+
+func (js *jsonStore) Get(num int) (Comic, bool, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	cmc, present := js.idx[strconv.Itoa(num)]
+	return cmc, present, nil
+}
+
+func (js *jsonStore) Put(cmc Comic) error {
+	js.mu.Lock()
+	js.idx[strconv.Itoa(cmc.Num)] = cmc
+	js.dirty++
+	shouldFlush := js.dirty >= flushEvery
+	js.mu.Unlock()
+
+	if shouldFlush {
+		return js.flush()
+	}
+	return nil
+}
+
+func (js *jsonStore) Iter() iter.Seq[Comic] {
+	js.mu.Lock()
+	cs := make([]Comic, 0, len(js.idx))
+	for _, cmc := range js.idx {
+		cs = append(cs, cmc)
+	}
+	js.mu.Unlock()
+
+	return func(yield func(Comic) bool) {
+		for _, cmc := range cs {
+			if !yield(cmc) {
+				return
+			}
+		}
+	}
+}
+
+func (js *jsonStore) Close() error {
+	return js.flush()
+}
+
+func (js *jsonStore) flush() error {
+	js.mu.Lock()
+	idx, err := json.Marshal(js.idx)
+	js.dirty = 0
+	js.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("unable to encode comic index: %s", err)
+	}
+
+	if err := ioutil.WriteFile(js.path, idx, 0644); err != nil {
+		return fmt.Errorf("unable to flush index to disk: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package xkcd
+
+import (
+	"testing"
+	"time"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParseDateRange(t *testing.T) {
+	cases := []struct {
+		val     string
+		in, out time.Time // a date expected to match, and one expected not to
+	}{
+		{"2019-06-01..2019-06-30", date(2019, 6, 15), date(2019, 7, 1)},
+		{"..2019-01-01", date(2018, 1, 1), date(2019, 1, 2)},
+		{"2019-01-01..", date(2020, 1, 1), date(2018, 12, 31)},
+		{"<2020-06-01", date(2020, 5, 31), date(2020, 6, 1)},
+		{"<=2020-06-01", date(2020, 6, 1), date(2020, 6, 2)},
+		{">2020-06-01", date(2020, 6, 2), date(2020, 6, 1)},
+		{">=2020-06-01", date(2020, 6, 1), date(2020, 5, 31)},
+		{"2020-06-01", date(2020, 6, 1), date(2020, 6, 2)},
+	}
+
+	for _, c := range cases {
+		r, ok := parseDateRange(c.val)
+		if !ok {
+			t.Fatalf("parseDateRange(%q): expected success", c.val)
+		}
+		if !r.contains(c.in) {
+			t.Errorf("parseDateRange(%q).contains(%s) = false, want true", c.val, c.in)
+		}
+		if r.contains(c.out) {
+			t.Errorf("parseDateRange(%q).contains(%s) = true, want false", c.val, c.out)
+		}
+	}
+
+	if _, ok := parseDateRange("not-a-date"); ok {
+		t.Error("parseDateRange(garbage): expected failure")
+	}
+}
+
+func TestParseDateRangeNegated(t *testing.T) {
+	r, ok := parseDateRange("2019-01-01..2019-12-31")
+	if !ok {
+		t.Fatal("parseDateRange: expected success")
+	}
+	r.negate = true
+
+	if r.contains(date(2019, 6, 1)) {
+		t.Error("negated range should exclude a date inside the range")
+	}
+	if !r.contains(date(2020, 1, 1)) {
+		t.Error("negated range should include a date outside the range")
+	}
+}
+
+func TestParseNumRange(t *testing.T) {
+	cases := []struct {
+		val     string
+		in, out int
+	}{
+		{"1000..1500", 1200, 1999},
+		{"..1500", 1000, 1999},
+		{"1000..", 1999, 999},
+		{"<1500", 1499, 1500},
+		{"<=1500", 1500, 1501},
+		{">1500", 1501, 1500},
+		{">=1500", 1500, 1499},
+		{"1500", 1500, 1501},
+	}
+
+	for _, c := range cases {
+		r, ok := parseNumRange(c.val)
+		if !ok {
+			t.Fatalf("parseNumRange(%q): expected success", c.val)
+		}
+		if !r.contains(c.in) {
+			t.Errorf("parseNumRange(%q).contains(%d) = false, want true", c.val, c.in)
+		}
+		if r.contains(c.out) {
+			t.Errorf("parseNumRange(%q).contains(%d) = true, want false", c.val, c.out)
+		}
+	}
+
+	if _, ok := parseNumRange("not-a-num"); ok {
+		t.Error("parseNumRange(garbage): expected failure")
+	}
+}
+
+func TestParseQueryNegatedQualifiers(t *testing.T) {
+	q := parseQuery("-year:2019 -num:1000..1500")
+
+	if len(q.created) != 1 || !q.created[0].negate {
+		t.Fatalf("expected -year:2019 to produce a negated dateRange, got %+v", q.created)
+	}
+	if q.created[0].contains(date(2019, 6, 1)) {
+		t.Error("-year:2019 should exclude comics published in 2019")
+	}
+	if !q.created[0].contains(date(2020, 1, 1)) {
+		t.Error("-year:2019 should include comics published outside 2019")
+	}
+
+	if len(q.nums) != 1 || !q.nums[0].negate {
+		t.Fatalf("expected -num:1000..1500 to produce a negated numRange, got %+v", q.nums)
+	}
+	if q.nums[0].contains(1200) {
+		t.Error("-num:1000..1500 should exclude comic 1200")
+	}
+	if !q.nums[0].contains(1600) {
+		t.Error("-num:1000..1500 should include comic 1600")
+	}
+}
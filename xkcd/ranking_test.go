@@ -0,0 +1,95 @@
+package xkcd
+
+import "testing"
+
+func newTestIndex(comics ...Comic) *Index {
+	return NewIndex(newFakeStore("", comics...))
+}
+
+func TestRankPrefersTitleHitOverTranscriptHit(t *testing.T) {
+	ix := newTestIndex(
+		Comic{Num: 1, Title: "Barrel", Transcript: "two people talk about nothing in particular"},
+		Comic{Num: 2, Title: "Petition", Transcript: "the barrel rolls down the hill"},
+	)
+	inv := buildInvertedIndex(ix)
+
+	nums := inv.rank(parseQuery("barrel"))
+	if len(nums) != 2 {
+		t.Fatalf("expected both comics to match, got %v", nums)
+	}
+	if nums[0] != 1 {
+		t.Fatalf("expected comic 1 (title hit) to outrank comic 2 (transcript hit), got order %v", nums)
+	}
+}
+
+func TestRankRequiresAllMustTerms(t *testing.T) {
+	ix := newTestIndex(
+		Comic{Num: 1, Title: "Barrel", Transcript: "a person stands alone"},
+		Comic{Num: 2, Title: "Two Barrels", Transcript: "a person stands alone"},
+	)
+	inv := buildInvertedIndex(ix)
+
+	nums := inv.rank(parseQuery("barrel person"))
+	if len(nums) != 2 {
+		t.Fatalf("expected both comics to contain both terms, got %v", nums)
+	}
+
+	nums = inv.rank(parseQuery("two person"))
+	if len(nums) != 1 || nums[0] != 2 {
+		t.Fatalf("expected only comic 2 to match 'two person', got %v", nums)
+	}
+}
+
+func TestRankExcludesMustNotTerms(t *testing.T) {
+	ix := newTestIndex(
+		Comic{Num: 1, Title: "Barrel", Transcript: "a person stands alone"},
+		Comic{Num: 2, Title: "Two Barrels", Transcript: "a person stands with a friend"},
+	)
+	inv := buildInvertedIndex(ix)
+
+	nums := inv.rank(parseQuery("barrel -friend"))
+	if len(nums) != 1 || nums[0] != 1 {
+		t.Fatalf("expected -friend to exclude comic 2, got %v", nums)
+	}
+}
+
+func TestMatchPhraseRequiresContiguousOrder(t *testing.T) {
+	ix := newTestIndex(
+		Comic{Num: 1, Transcript: "a big barrel of monkeys"},
+		Comic{Num: 2, Transcript: "a barrel, then later, monkeys"},
+	)
+	inv := buildInvertedIndex(ix)
+
+	matches := inv.matchPhrase(tokenize("barrel of monkeys"), "")
+	if _, ok := matches[1]; !ok {
+		t.Error("expected comic 1 to match the contiguous phrase 'barrel of monkeys'")
+	}
+	if _, ok := matches[2]; ok {
+		t.Error("comic 2's scattered terms should not match the phrase")
+	}
+}
+
+func TestParseQueryQuotedQualifierValue(t *testing.T) {
+	q := parseQuery(`title:"barrel of monkeys" -excluded`)
+
+	if len(q.must) != 1 {
+		t.Fatalf("expected exactly one must term, got %+v", q.must)
+	}
+	term := q.must[0]
+	if term.field != "title" {
+		t.Fatalf("expected the quoted qualifier value to stay restricted to title, got field %q", term.field)
+	}
+	want := []string{"barrel", "of", "monkey"}
+	if len(term.tokens) != len(want) {
+		t.Fatalf("expected tokens %v, got %v", want, term.tokens)
+	}
+	for i, tok := range want {
+		if term.tokens[i] != tok {
+			t.Errorf("token %d = %q, want %q", i, term.tokens[i], tok)
+		}
+	}
+
+	if len(q.mustNot) != 1 {
+		t.Fatalf("expected -excluded to still parse as a mustNot term, got %+v", q.mustNot)
+	}
+}
@@ -0,0 +1,764 @@
+// -----
+// search.go
+//
+// A ranked full-text search index over the comic index: tokenizes Title,
+// SafeTitle, Alt and Transcript into an inverted index and scores queries
+// with BM25, weighted so a hit in the title counts for more than a hit in
+// the transcript.
+// -----
+
+package xkcd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// invIndexPath returns where the inverted index for store is persisted.
+// It's namespaced by the store's own path so switching the -store backend
+// (e.g. json to bin) can never load a cached index built from the other
+// backend's comics just because the two happen to hold the same count.
+func invIndexPath(store Store) string {
+	return store.Path() + ".idx"
+}
+
+// BM25 tuning constants; 1.2/0.75 are the standard defaults.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// fieldWeights boosts matches in more significant fields: a hit in the
+// title is worth more than the same term buried in the transcript.
+var fieldWeights = map[string]float64{
+	"title":      3.0,
+	"safe_title": 2.5,
+	"alt":        2.0,
+	"transcript": 1.0,
+}
+
+var searchFields = []struct {
+	name string
+	get  func(Comic) string
+}{
+	{"title", func(c Comic) string { return c.Title }},
+	{"safe_title", func(c Comic) string { return c.SafeTitle }},
+	{"alt", func(c Comic) string { return c.Alt }},
+	{"transcript", func(c Comic) string { return c.Transcript }},
+}
+
+// posting records every position a term occurs at, within one comic's field.
+type posting struct {
+	Num       int    `json:"num"`
+	Field     string `json:"field"`
+	Positions []int  `json:"positions"`
+}
+
+// invertedIndex maps terms to the postings they occur in, plus the field
+// lengths needed for BM25's length normalization.
+type invertedIndex struct {
+	Postings  map[string][]posting   `json:"postings"`
+	DocLen    map[int]map[string]int `json:"doc_len"`
+	AvgDocLen map[string]float64     `json:"avg_doc_len"`
+	N         int                    `json:"n"`
+
+	// Source records which store this index was built from, so a cached
+	// index can be told apart from one built against a different backend
+	// even when both happen to hold the same number of comics.
+	Source string `json:"source"`
+}
+
+// tokenize lowercases s, splits it on anything that isn't a letter or
+// digit, and stems each resulting word.
+func tokenize(s string) []string {
+	var tokens []string
+	var b strings.Builder
+
+	flush := func() {
+		if b.Len() > 0 {
+			tokens = append(tokens, stem(b.String()))
+			b.Reset()
+		}
+	}
+
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else {
+			flush()
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// stem applies a handful of common English suffix-stripping rules. It's
+// not a full Porter stemmer, just enough to fold "comics"/"comic" and
+// "indexing"/"indexed"/"index" together.
+func stem(w string) string {
+	switch {
+	case strings.HasSuffix(w, "ies") && len(w) > 4:
+		return w[:len(w)-3] + "y"
+	case strings.HasSuffix(w, "ing") && len(w) > 5:
+		return w[:len(w)-3]
+	case strings.HasSuffix(w, "ed") && len(w) > 4:
+		return w[:len(w)-2]
+	case strings.HasSuffix(w, "es") && len(w) > 4:
+		return w[:len(w)-2]
+	case strings.HasSuffix(w, "s") && len(w) > 3 && !strings.HasSuffix(w, "ss"):
+		return w[:len(w)-1]
+	}
+	return w
+}
+
+// buildInvertedIndex tokenizes every comic in ix and builds a fresh
+// inverted index from scratch.
+func buildInvertedIndex(ix *Index) *invertedIndex {
+	inv := &invertedIndex{
+		Postings:  make(map[string][]posting),
+		DocLen:    make(map[int]map[string]int),
+		AvgDocLen: make(map[string]float64),
+		Source:    ix.store.Path(),
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	fieldTotals := make(map[string]int)
+
+	for _, cmc := range ix.idx {
+		inv.DocLen[cmc.Num] = make(map[string]int)
+
+		for _, f := range searchFields {
+			tokens := tokenize(f.get(cmc))
+			inv.DocLen[cmc.Num][f.name] = len(tokens)
+			fieldTotals[f.name] += len(tokens)
+
+			positions := make(map[string][]int)
+			for i, t := range tokens {
+				positions[t] = append(positions[t], i)
+			}
+			for term, pos := range positions {
+				inv.Postings[term] = append(inv.Postings[term], posting{Num: cmc.Num, Field: f.name, Positions: pos})
+			}
+		}
+		inv.N++
+	}
+
+	for _, f := range searchFields {
+		if inv.N > 0 {
+			inv.AvgDocLen[f.name] = float64(fieldTotals[f.name]) / float64(inv.N)
+		}
+	}
+
+	return inv
+}
+
+// loadInvertedIndex loads the index persisted alongside ix's store,
+// rebuilding it if it's missing, stale relative to ix, or was built from a
+// different store (e.g. a leftover index from running with -store json
+// right after switching to -store bin).
+func loadInvertedIndex(ix *Index) (*invertedIndex, error) {
+	path := invIndexPath(ix.store)
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return buildAndSaveInvertedIndex(ix)
+	}
+
+	var inv invertedIndex
+	if err := json.Unmarshal(b, &inv); err != nil {
+		return buildAndSaveInvertedIndex(ix)
+	}
+
+	ix.mu.Lock()
+	stale := inv.Source != ix.store.Path() || inv.N != len(ix.idx)
+	ix.mu.Unlock()
+	if stale {
+		return buildAndSaveInvertedIndex(ix)
+	}
+
+	return &inv, nil
+}
+
+func buildAndSaveInvertedIndex(ix *Index) (*invertedIndex, error) {
+	inv := buildInvertedIndex(ix)
+	if err := dumpInvertedIndex(ix.store, inv); err != nil {
+		return inv, err
+	}
+	return inv, nil
+}
+
+func dumpInvertedIndex(store Store, inv *invertedIndex) error {
+	b, err := json.Marshal(inv)
+	if err != nil {
+		return fmt.Errorf("unable to encode search index: %s", err)
+	}
+
+	if err := ioutil.WriteFile(invIndexPath(store), b, 0644); err != nil {
+		return fmt.Errorf("unable to flush search index to disk: %s", err)
+	}
+
+	return nil
+}
+
+// queryTerm is a single required or excluded term/phrase. field restricts
+// matching to one searchFields entry (e.g. "title" for a title:foo
+// qualifier); an empty field matches any of them, as bare terms always do.
+type queryTerm struct {
+	tokens []string
+	field  string
+}
+
+// parsedQuery is a query broken into required terms, excluded terms, and
+// GitHub-style qualifiers (created:, year:, num:) that filter rather than
+// rank. Term entries are token slices so that quoted phrases ("a b c") are
+// kept together for exact matching, while bare words are single-token
+// entries.
+type parsedQuery struct {
+	must    []queryTerm
+	mustNot []queryTerm
+	created []dateRange
+	nums    []numRange
+}
+
+// matchesFilters reports whether cmc satisfies every created:/num:
+// qualifier in q. It does not consider must/mustNot -- those are evaluated
+// against the inverted index in rank.
+func (q parsedQuery) matchesFilters(cmc Comic) bool {
+	for _, r := range q.created {
+		if !r.contains(cmc.PublishDate) {
+			return false
+		}
+	}
+	for _, r := range q.nums {
+		if !r.contains(cmc.Num) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseQuery supports bare terms (ANDed together), "quoted phrases" for
+// exact matches, -excluded terms, a title:foo qualifier that restricts a
+// term to the title field, and year:/created:/num: qualifiers that filter
+// results by publish date or comic number rather than contributing to the
+// ranked score. Any qualifier may be negated (-year:2019,
+// -created:<2020-01-01, -num:1..100) to exclude instead of require.
+func parseQuery(phrase string) parsedQuery {
+	var q parsedQuery
+	runes := []rune(phrase)
+
+	for i := 0; i < len(runes); {
+		for i < len(runes) && runes[i] == ' ' {
+			i++
+		}
+		if i >= len(runes) {
+			break
+		}
+
+		negate := false
+		if runes[i] == '-' {
+			negate = true
+			i++
+		}
+
+		// Look ahead for a `key:value` qualifier before falling back to
+		// the plain quoted-phrase/bare-word cases, so a qualifier's value
+		// can itself be a quoted phrase (title:"foo bar") instead of the
+		// unquoted-word scan stopping at the first space inside it.
+		keyEnd := i
+		for keyEnd < len(runes) && runes[keyEnd] != ' ' && runes[keyEnd] != ':' {
+			keyEnd++
+		}
+
+		var raw string
+		if keyEnd > i && keyEnd < len(runes) && runes[keyEnd] == ':' {
+			key := string(runes[i:keyEnd])
+			i = keyEnd + 1
+
+			var val string
+			if i < len(runes) && runes[i] == '"' {
+				i++
+				start := i
+				for i < len(runes) && runes[i] != '"' {
+					i++
+				}
+				val = string(runes[start:i])
+				if i < len(runes) {
+					i++ // consume closing quote
+				}
+			} else {
+				start := i
+				for i < len(runes) && runes[i] != ' ' {
+					i++
+				}
+				val = string(runes[start:i])
+			}
+			raw = key + ":" + val
+		} else if runes[i] == '"' {
+			i++
+			start := i
+			for i < len(runes) && runes[i] != '"' {
+				i++
+			}
+			raw = string(runes[start:i])
+			if i < len(runes) {
+				i++ // consume closing quote
+			}
+		} else {
+			start := i
+			for i < len(runes) && runes[i] != ' ' {
+				i++
+			}
+			raw = string(runes[start:i])
+		}
+
+		if key, val, ok := strings.Cut(raw, ":"); ok && key != "" {
+			switch key {
+			case "year":
+				if yr, err := strconv.Atoi(val); err == nil {
+					r := yearRange(yr)
+					r.negate = negate
+					q.created = append(q.created, r)
+					continue
+				}
+			case "created":
+				if r, ok := parseDateRange(val); ok {
+					r.negate = negate
+					q.created = append(q.created, r)
+					continue
+				}
+			case "num":
+				if r, ok := parseNumRange(val); ok {
+					r.negate = negate
+					q.nums = append(q.nums, r)
+					continue
+				}
+			case "title":
+				if tokens := tokenize(val); len(tokens) > 0 {
+					term := queryTerm{tokens: tokens, field: "title"}
+					if negate {
+						q.mustNot = append(q.mustNot, term)
+					} else {
+						q.must = append(q.must, term)
+					}
+					continue
+				}
+			}
+		}
+
+		tokens := tokenize(raw)
+		if len(tokens) == 0 {
+			continue
+		}
+		term := queryTerm{tokens: tokens}
+		if negate {
+			q.mustNot = append(q.mustNot, term)
+		} else {
+			q.must = append(q.must, term)
+		}
+	}
+
+	return q
+}
+
+// dateRange is an inclusive [from, to] bound on a comic's PublishDate,
+// either side of which may be absent (hasFrom/hasTo false). negate flips
+// it into an exclusion, for a qualifier like -created:2019-01-01..2019-12-31.
+type dateRange struct {
+	from, to       time.Time
+	hasFrom, hasTo bool
+	negate         bool
+}
+
+func (r dateRange) contains(t time.Time) bool {
+	in := true
+	if r.hasFrom && t.Before(r.from) {
+		in = false
+	}
+	if r.hasTo && t.After(r.to) {
+		in = false
+	}
+	if r.negate {
+		return !in
+	}
+	return in
+}
+
+// yearRange builds the dateRange spanning all of yr, for the year:YYYY
+// qualifier.
+func yearRange(yr int) dateRange {
+	return dateRange{
+		from:    time.Date(yr, time.January, 1, 0, 0, 0, 0, time.UTC),
+		to:      time.Date(yr, time.December, 31, 0, 0, 0, 0, time.UTC),
+		hasFrom: true,
+		hasTo:   true,
+	}
+}
+
+// parseDateRange parses a created: qualifier's value: "2018-01-01..2019-01-01"
+// (either side may be omitted for an open range), "<2020-06-01" / "<=" /
+// ">" / ">=" for a one-sided bound, or a bare "2020-06-01" for a single day.
+func parseDateRange(val string) (dateRange, bool) {
+	for _, op := range []string{"<=", ">=", "<", ">"} {
+		rest, ok := strings.CutPrefix(val, op)
+		if !ok {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", rest)
+		if err != nil {
+			return dateRange{}, false
+		}
+		switch op {
+		case "<":
+			return dateRange{to: t.AddDate(0, 0, -1), hasTo: true}, true
+		case "<=":
+			return dateRange{to: t, hasTo: true}, true
+		case ">":
+			return dateRange{from: t.AddDate(0, 0, 1), hasFrom: true}, true
+		default: // ">="
+			return dateRange{from: t, hasFrom: true}, true
+		}
+	}
+
+	if idx := strings.Index(val, ".."); idx >= 0 {
+		var r dateRange
+		if fromStr := val[:idx]; fromStr != "" {
+			t, err := time.Parse("2006-01-02", fromStr)
+			if err != nil {
+				return dateRange{}, false
+			}
+			r.from, r.hasFrom = t, true
+		}
+		if toStr := val[idx+2:]; toStr != "" {
+			t, err := time.Parse("2006-01-02", toStr)
+			if err != nil {
+				return dateRange{}, false
+			}
+			r.to, r.hasTo = t, true
+		}
+		if !r.hasFrom && !r.hasTo {
+			return dateRange{}, false
+		}
+		return r, true
+	}
+
+	t, err := time.Parse("2006-01-02", val)
+	if err != nil {
+		return dateRange{}, false
+	}
+	return dateRange{from: t, to: t, hasFrom: true, hasTo: true}, true
+}
+
+// numRange is an inclusive [from, to] bound on a comic's Num, either side
+// of which may be absent (hasFrom/hasTo false). negate flips it into an
+// exclusion, for a qualifier like -num:1000..1500.
+type numRange struct {
+	from, to       int
+	hasFrom, hasTo bool
+	negate         bool
+}
+
+func (r numRange) contains(n int) bool {
+	in := true
+	if r.hasFrom && n < r.from {
+		in = false
+	}
+	if r.hasTo && n > r.to {
+		in = false
+	}
+	if r.negate {
+		return !in
+	}
+	return in
+}
+
+// parseNumRange parses a num: qualifier's value the same way parseDateRange
+// does: "1000..1500", "<1500" / "<=" / ">" / ">=", or a bare "1000".
+func parseNumRange(val string) (numRange, bool) {
+	for _, op := range []string{"<=", ">=", "<", ">"} {
+		rest, ok := strings.CutPrefix(val, op)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(rest)
+		if err != nil {
+			return numRange{}, false
+		}
+		switch op {
+		case "<":
+			return numRange{to: n - 1, hasTo: true}, true
+		case "<=":
+			return numRange{to: n, hasTo: true}, true
+		case ">":
+			return numRange{from: n + 1, hasFrom: true}, true
+		default: // ">="
+			return numRange{from: n, hasFrom: true}, true
+		}
+	}
+
+	if idx := strings.Index(val, ".."); idx >= 0 {
+		var r numRange
+		if fromStr := val[:idx]; fromStr != "" {
+			n, err := strconv.Atoi(fromStr)
+			if err != nil {
+				return numRange{}, false
+			}
+			r.from, r.hasFrom = n, true
+		}
+		if toStr := val[idx+2:]; toStr != "" {
+			n, err := strconv.Atoi(toStr)
+			if err != nil {
+				return numRange{}, false
+			}
+			r.to, r.hasTo = n, true
+		}
+		if !r.hasFrom && !r.hasTo {
+			return numRange{}, false
+		}
+		return r, true
+	}
+
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return numRange{}, false
+	}
+	return numRange{from: n, to: n, hasFrom: true, hasTo: true}, true
+}
+
+// idf is the standard BM25 inverse document frequency for a single term.
+func (inv *invertedIndex) idf(term string) float64 {
+	docs := make(map[int]bool)
+	for _, p := range inv.Postings[term] {
+		docs[p.Num] = true
+	}
+
+	df := len(docs)
+	if df == 0 {
+		return 0
+	}
+	return math.Log(1 + (float64(inv.N)-float64(df)+0.5)/(float64(df)+0.5))
+}
+
+// matchPhrase returns, for every comic/field containing tokens as a
+// contiguous run, how many times it occurs there. When field is non-empty,
+// only that field is considered (used for field-restricted qualifiers like
+// title:foo); an empty field matches any of searchFields.
+func (inv *invertedIndex) matchPhrase(tokens []string, field string) map[int]map[string]int {
+	matches := make(map[int]map[string]int)
+	if len(tokens) == 0 {
+		return matches
+	}
+
+	record := func(num int, field string, count int) {
+		if count == 0 {
+			return
+		}
+		if matches[num] == nil {
+			matches[num] = make(map[string]int)
+		}
+		matches[num][field] += count
+	}
+
+	if len(tokens) == 1 {
+		for _, p := range inv.Postings[tokens[0]] {
+			if field != "" && p.Field != field {
+				continue
+			}
+			record(p.Num, p.Field, len(p.Positions))
+		}
+		return matches
+	}
+
+	for _, first := range inv.Postings[tokens[0]] {
+		if field != "" && first.Field != field {
+			continue
+		}
+
+		rest := make([][]int, 0, len(tokens)-1)
+		ok := true
+		for _, t := range tokens[1:] {
+			pos := postingPositions(inv.Postings[t], first.Num, first.Field)
+			if pos == nil {
+				ok = false
+				break
+			}
+			rest = append(rest, pos)
+		}
+		if !ok {
+			continue
+		}
+
+		count := 0
+		for _, start := range first.Positions {
+			aligned := true
+			for offset, positions := range rest {
+				if !containsInt(positions, start+offset+1) {
+					aligned = false
+					break
+				}
+			}
+			if aligned {
+				count++
+			}
+		}
+		record(first.Num, first.Field, count)
+	}
+
+	return matches
+}
+
+func postingPositions(postings []posting, num int, field string) []int {
+	for _, p := range postings {
+		if p.Num == num && p.Field == field {
+			return p.Positions
+		}
+	}
+	return nil
+}
+
+func containsInt(s []int, v int) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// score runs BM25 (weighted per field) for a single required term/phrase,
+// returning each matching comic's contribution.
+func (inv *invertedIndex) score(term queryTerm) map[int]float64 {
+	matches := inv.matchPhrase(term.tokens, term.field)
+
+	idfVal := inv.idf(term.tokens[0])
+	for _, t := range term.tokens[1:] {
+		if v := inv.idf(t); v < idfVal {
+			idfVal = v
+		}
+	}
+
+	scores := make(map[int]float64)
+	for num, fields := range matches {
+		for field, tf := range fields {
+			dl := float64(inv.DocLen[num][field])
+			avgdl := inv.AvgDocLen[field]
+			if avgdl == 0 {
+				avgdl = 1
+			}
+
+			norm := (float64(tf) * (bm25K1 + 1)) / (float64(tf) + bm25K1*(1-bm25B+bm25B*(dl/avgdl)))
+			scores[num] += fieldWeights[field] * idfVal * norm
+		}
+	}
+	return scores
+}
+
+// rank evaluates q's must/mustNot terms against the index and returns
+// matching comic numbers sorted by descending BM25 score. A query with no
+// must terms (e.g. a bare "year:2019") matches every indexed comic, scored
+// at zero, so that created:/num: qualifiers can still filter it down in
+// Search -- it isn't treated as "no results".
+func (inv *invertedIndex) rank(q parsedQuery) []int {
+	totals := make(map[int]float64)
+
+	if len(q.must) == 0 {
+		for num := range inv.DocLen {
+			totals[num] = 0
+		}
+	} else {
+		matchedByTerm := make([]map[int]bool, len(q.must))
+
+		for i, term := range q.must {
+			scores := inv.score(term)
+			matched := make(map[int]bool, len(scores))
+			for num, s := range scores {
+				totals[num] += s
+				matched[num] = true
+			}
+			matchedByTerm[i] = matched
+		}
+
+		for num := range totals {
+			for _, matched := range matchedByTerm {
+				if !matched[num] {
+					delete(totals, num)
+					break
+				}
+			}
+		}
+	}
+
+	for _, term := range q.mustNot {
+		for num := range inv.matchPhrase(term.tokens, term.field) {
+			delete(totals, num)
+		}
+	}
+
+	type scored struct {
+		num   int
+		score float64
+	}
+	ranked := make([]scored, 0, len(totals))
+	for num, s := range totals {
+		ranked = append(ranked, scored{num, s})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].num < ranked[j].num
+	})
+
+	nums := make([]int, len(ranked))
+	for i, r := range ranked {
+		nums[i] = r.num
+	}
+	return nums
+}
+
+// Search runs phrase as a query against the comic index -- title, alt and
+// transcript qualify, "exact phrases" match consecutive terms, -term
+// excludes results, title:foo restricts a term to the title field, and
+// year:2019 / created:2018-01-01..2019-01-01 / num:1000..1500 style
+// qualifiers filter by publish date or comic number -- returning comics
+// ranked by BM25 score.
+func (ix *Index) Search(phrase string) ([]Comic, error) {
+	if strings.TrimSpace(phrase) == "" {
+		return nil, nil
+	}
+
+	q := parseQuery(phrase)
+
+	if ix.searchIdx == nil {
+		inv, err := loadInvertedIndex(ix)
+		if err != nil {
+			return nil, fmt.Errorf("unable to build search index: %s", err)
+		}
+		ix.searchIdx = inv
+	}
+
+	nums := ix.searchIdx.rank(q)
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	cList := make([]Comic, 0, len(nums))
+	for _, num := range nums {
+		cmc, ok := ix.idx[strconv.Itoa(num)]
+		if !ok || !q.matchesFilters(cmc) {
+			continue
+		}
+		cList = append(cList, cmc)
+	}
+	return cList, nil
+}
@@ -0,0 +1,79 @@
+package xkcd
+
+import (
+	"iter"
+	"path/filepath"
+	"testing"
+)
+
+// fakeStore is a minimal in-memory Store, used to exercise loadInvertedIndex
+// against two distinct backends without a real store file behind either.
+type fakeStore struct {
+	path string
+	idx  map[int]Comic
+}
+
+func newFakeStore(path string, comics ...Comic) *fakeStore {
+	idx := make(map[int]Comic, len(comics))
+	for _, c := range comics {
+		idx[c.Num] = c
+	}
+	return &fakeStore{path: path, idx: idx}
+}
+
+func (s *fakeStore) Get(num int) (Comic, bool, error) {
+	c, ok := s.idx[num]
+	return c, ok, nil
+}
+
+func (s *fakeStore) Put(cmc Comic) error {
+	s.idx[cmc.Num] = cmc
+	return nil
+}
+
+func (s *fakeStore) Iter() iter.Seq[Comic] {
+	return func(yield func(Comic) bool) {
+		for _, c := range s.idx {
+			if !yield(c) {
+				return
+			}
+		}
+	}
+}
+
+func (s *fakeStore) Close() error { return nil }
+
+func (s *fakeStore) Path() string { return s.path }
+
+// TestLoadInvertedIndexDoesNotLeakAcrossStores covers the case where two
+// different store backends happen to hold the same number of comics: the
+// persisted search index must be keyed by store, not just by count, or
+// switching -store would silently serve results built from the other
+// backend's comics.
+func TestLoadInvertedIndexDoesNotLeakAcrossStores(t *testing.T) {
+	dir := t.TempDir()
+
+	jsonLike := newFakeStore(filepath.Join(dir, "comix.dat"), Comic{Num: 1, Title: "foo"})
+	ixJSON := NewIndex(jsonLike)
+	invJSON, err := loadInvertedIndex(ixJSON)
+	if err != nil {
+		t.Fatalf("loadInvertedIndex(json-like): %s", err)
+	}
+
+	binLike := newFakeStore(filepath.Join(dir, "comix.bin"), Comic{Num: 2, Title: "bar"})
+	ixBin := NewIndex(binLike)
+	invBin, err := loadInvertedIndex(ixBin)
+	if err != nil {
+		t.Fatalf("loadInvertedIndex(bin-like): %s", err)
+	}
+
+	if invBin.Source == invJSON.Source {
+		t.Fatalf("expected distinct sources, both report %q", invBin.Source)
+	}
+	if _, ok := invBin.DocLen[1]; ok {
+		t.Fatal("bin-like index should not contain comic 1 from the json-like store")
+	}
+	if _, ok := invBin.DocLen[2]; !ok {
+		t.Fatal("bin-like index is missing comic 2")
+	}
+}
@@ -0,0 +1,109 @@
+// -----
+// sixel.go
+//
+// A small DEC sixel encoder so -sixel can render a downloaded comic
+// inline in terminals that support it (iTerm2, xterm -ti vt340, mlterm,
+// ...). Colors are quantized to a fixed 6x6x6 cube rather than computing
+// an optimal palette -- good enough for xkcd's mostly black-and-white line
+// art, and much simpler than a full median-cut quantizer.
+// -----
+
+package xkcd
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"strings"
+)
+
+const sixelCubeLevels = 6
+
+// RenderSixel decodes the image at path and writes its sixel-encoded form
+// to stdout.
+func RenderSixel(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open image: %s", err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return fmt.Errorf("unable to decode image: %s", err)
+	}
+
+	_, err = io.WriteString(os.Stdout, encodeSixel(img))
+	return err
+}
+
+// cubeIndex maps a 16-bit (0-0xffff) channel value, as returned by
+// color.Color.RGBA, onto one of sixelCubeLevels evenly spaced levels.
+func cubeIndex(v uint32) int {
+	return int(v >> 8 * sixelCubeLevels / 256)
+}
+
+func cubeLevel(i int) int {
+	return i * 100 / (sixelCubeLevels - 1)
+}
+
+func encodeSixel(img image.Image) string {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// Quantize every pixel to a color-cube index up front.
+	indices := make([][]int, height)
+	for y := 0; y < height; y++ {
+		indices[y] = make([]int, width)
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			indices[y][x] = (cubeIndex(r)*sixelCubeLevels+cubeIndex(g))*sixelCubeLevels + cubeIndex(b)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1bPq\n")
+
+	for ci := 0; ci < sixelCubeLevels*sixelCubeLevels*sixelCubeLevels; ci++ {
+		r := cubeLevel(ci / (sixelCubeLevels * sixelCubeLevels))
+		g := cubeLevel((ci / sixelCubeLevels) % sixelCubeLevels)
+		bl := cubeLevel(ci % sixelCubeLevels)
+		fmt.Fprintf(&b, "#%d;2;%d;%d;%d", ci, r, g, bl)
+	}
+	b.WriteByte('\n')
+
+	for y0 := 0; y0 < height; y0 += 6 {
+		used := map[int]bool{}
+		for dy := 0; dy < 6 && y0+dy < height; dy++ {
+			for x := 0; x < width; x++ {
+				used[indices[y0+dy][x]] = true
+			}
+		}
+
+		first := true
+		for ci := range used {
+			if !first {
+				b.WriteByte('$')
+			}
+			first = false
+
+			fmt.Fprintf(&b, "#%d", ci)
+			for x := 0; x < width; x++ {
+				mask := 0
+				for dy := 0; dy < 6 && y0+dy < height; dy++ {
+					if indices[y0+dy][x] == ci {
+						mask |= 1 << uint(dy)
+					}
+				}
+				b.WriteByte(byte(63 + mask))
+			}
+		}
+		b.WriteByte('-')
+	}
+
+	b.WriteString("\x1b\\")
+	return b.String()
+}
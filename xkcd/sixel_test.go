@@ -0,0 +1,44 @@
+package xkcd
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestEncodeSixelProducesValidEscapeSequence(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 50), G: uint8(y * 50), B: 100, A: 255})
+		}
+	}
+
+	out := encodeSixel(img)
+
+	if !strings.HasPrefix(out, "\x1bPq\n") {
+		t.Fatalf("expected sixel output to start with the DCS introducer, got %q", out[:min(10, len(out))])
+	}
+	if !strings.HasSuffix(out, "\x1b\\") {
+		t.Fatalf("expected sixel output to end with the ST terminator, got %q", out[len(out)-min(10, len(out)):])
+	}
+}
+
+func TestCubeIndexSpansFullRange(t *testing.T) {
+	if got := cubeIndex(0); got != 0 {
+		t.Errorf("cubeIndex(0) = %d, want 0", got)
+	}
+	if got := cubeIndex(0xffff); got != sixelCubeLevels-1 {
+		t.Errorf("cubeIndex(0xffff) = %d, want %d", got, sixelCubeLevels-1)
+	}
+}
+
+func TestCubeLevelSpansPercentRange(t *testing.T) {
+	if got := cubeLevel(0); got != 0 {
+		t.Errorf("cubeLevel(0) = %d, want 0", got)
+	}
+	if got := cubeLevel(sixelCubeLevels - 1); got != 100 {
+		t.Errorf("cubeLevel(%d) = %d, want 100", sixelCubeLevels-1, got)
+	}
+}
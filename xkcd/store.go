@@ -0,0 +1,68 @@
+// -----
+// store.go
+//
+// Store abstracts how the comic index is persisted to disk, so the JSON
+// blob format and the append-only binary format can be swapped via the
+// -store flag without touching the indexing or search code.
+// -----
+
+package xkcd
+
+import (
+	"fmt"
+	"iter"
+)
+
+const jsonStorePath = "./comix.dat"
+const binStorePath = "./comix.bin"
+
+// flushEvery controls how often the json store writes the index to disk
+// while indexing, so an interrupted run only loses at most this many fetches.
+const flushEvery = 25
+
+// Store persists comics to disk. Implementations must be safe for
+// concurrent use, since GetComics's workers call Put from multiple
+// goroutines.
+type Store interface {
+	// Get returns the comic numbered num, and whether it was found.
+	Get(num int) (Comic, bool, error)
+	// Put writes cmc to the store, creating or overwriting its record.
+	Put(cmc Comic) error
+	// Iter yields every comic currently in the store.
+	Iter() iter.Seq[Comic]
+	// Close flushes any buffered writes and releases the underlying file.
+	Close() error
+	// Path returns the on-disk location backing this store. It identifies
+	// the backend for auxiliary state keyed per store, like the persisted
+	// search index (see invIndexPath in search.go).
+	Path() string
+}
+
+// OpenStore opens the store backend named by kind ("json" or "bin").
+func OpenStore(kind string) (Store, error) {
+	switch kind {
+	case "json":
+		return openJSONStore(jsonStorePath)
+	case "bin", "binary":
+		return openBinStore(binStorePath)
+	default:
+		return nil, fmt.Errorf("unknown store backend: %s", kind)
+	}
+}
+
+// MigrateStore copies every comic currently held by ix into a freshly
+// opened store of kind destKind and flushes it to disk.
+func MigrateStore(ix *Index, destKind string) error {
+	dest, err := OpenStore(destKind)
+	if err != nil {
+		return err
+	}
+
+	for _, cmc := range ix.idx {
+		if err := dest.Put(cmc); err != nil {
+			return fmt.Errorf("unable to migrate comic %v: %s", cmc.Num, err)
+		}
+	}
+
+	return dest.Close()
+}
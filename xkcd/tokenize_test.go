@@ -0,0 +1,42 @@
+package xkcd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"Comic's Transcript!", []string{"comic", "s", "transcript"}},
+		{"indexing indexed index", []string{"index", "index", "index"}},
+		{"one-two_three", []string{"one", "two", "three"}},
+	}
+
+	for _, c := range cases {
+		got := tokenize(c.in)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("tokenize(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestStem(t *testing.T) {
+	cases := map[string]string{
+		"comics":   "comic",
+		"indexing": "index",
+		"indexed":  "index",
+		"boxes":    "box",
+		"glass":    "glass", // double-s shouldn't be treated as a plural
+		"cat":      "cat",   // too short to strip
+	}
+
+	for in, want := range cases {
+		if got := stem(in); got != want {
+			t.Errorf("stem(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
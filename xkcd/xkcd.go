@@ -0,0 +1,252 @@
+// -----
+// xkcd.go
+//
+// Core types for fetching and indexing xkcd comics: the Comic metadata
+// shape returned by the xkcd API, and Index, the in-memory cache (backed
+// by a Store) that indexing and search both operate on.
+// -----
+
+package xkcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const xkcdURL = "https://xkcd.com/"
+const xkcdSuffix = "info.0.json"
+
+// notFoundComic is the one comic number the xkcd API always 404s on.
+const notFoundComic = 404
+
+// Comic is the metadata the xkcd API returns for a single comic.
+type Comic struct {
+	Month      string
+	Num        int
+	Link       string
+	Year       string
+	News       string
+	SafeTitle  string `json:"safe_title"`
+	Transcript string
+	Alt        string
+	Img        string
+	Title      string
+	Day        string
+
+	// PublishDate is Year/Month/Day parsed into a time.Time (UTC, day
+	// granularity), so search can evaluate date-range qualifiers without
+	// re-parsing the string fields on every query. It's computed once at
+	// fetch time; see publishDate.
+	PublishDate time.Time `json:"publish_date"`
+}
+
+// publishDate parses a comic's Year/Month/Day fields into a UTC time.Time
+// truncated to day granularity. It returns the zero time if any of the
+// fields fail to parse.
+func publishDate(cmc Comic) time.Time {
+	year, err := strconv.Atoi(cmc.Year)
+	if err != nil {
+		return time.Time{}
+	}
+	month, err := strconv.Atoi(cmc.Month)
+	if err != nil {
+		return time.Time{}
+	}
+	day, err := strconv.Atoi(cmc.Day)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+// Index is an in-memory cache of comics, persisted through a Store.
+type Index struct {
+	mu    sync.Mutex
+	idx   map[string]Comic
+	store Store
+
+	// searchIdx is the inverted index backing search. It is built lazily
+	// on the first search and cached for the lifetime of the process.
+	searchIdx *invertedIndex
+}
+
+// NewIndex builds an in-memory Index backed by store, seeding its cache
+// from whatever store already has on disk.
+func NewIndex(store Store) *Index {
+	idx := &Index{idx: make(map[string]Comic), store: store}
+
+	for cmc := range store.Iter() {
+		if cmc.PublishDate.IsZero() {
+			cmc.PublishDate = publishDate(cmc)
+		}
+		idx.idx[strconv.Itoa(cmc.Num)] = cmc
+	}
+
+	return idx
+}
+
+// Close flushes the index's backing store to disk.
+func (ix *Index) Close() error {
+	return ix.store.Close()
+}
+
+// GetComics fetches comics numbered [latest-n, latest] using a bounded
+// pool of workers, persisting ix to disk every flushEvery successful
+// fetches so that an interrupted run (e.g. via Ctrl-C) can resume from
+// where it left off instead of losing everything. Cancelling ctx stops
+// dispatching new work and returns once the in-flight fetches drain,
+// leaving whatever was indexed so far ready to be flushed by the caller.
+func GetComics(ctx context.Context, spec string, ix *Index, workers int) {
+	var n int
+
+	// TODO: Take this section that calculates the index and place it in its own code
+	latest, err := getLatest(ctx)
+	if err != nil {
+		log.Fatalf("Unable to get latest xkcd comic number: %s", err)
+	}
+
+	if spec != "all" {
+		n, err = strconv.Atoi(spec)
+		if err != nil {
+			log.Fatalf("invalid value for index: %v", n)
+		}
+		n = n - 1
+	} else {
+		n = latest
+	}
+	// TODO: See note above
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				log.Printf("Getting comic %v...", i)
+				current, err := getComic(ctx, i)
+				if err != nil {
+					log.Printf("Unable to get xkcd comic: %s", err)
+					continue
+				}
+
+				log.Printf("Got comic %v", current.Num)
+				ix.indexComic(current)
+			}
+		}()
+	}
+
+dispatch:
+	for i := latest; i >= latest-n; i-- {
+		if i == notFoundComic {
+			log.Printf("Skipping comic %v, the xkcd API always 404s on it", i)
+			continue
+		}
+
+		cNum := strconv.Itoa(i)
+		if ix.has(cNum) {
+			log.Printf("Comic already indexed.")
+			continue
+		}
+
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			log.Printf("Interrupted, waiting for in-flight fetches to finish...")
+			break dispatch
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+}
+
+func getLatest(ctx context.Context) (int, error) {
+	latest, err := getComic(ctx, 0)
+	if err != nil {
+		return -1, err
+	}
+
+	log.Printf("Latest comic number is %v", latest.Num)
+	return latest.Num, nil
+}
+
+// getComic fetches the metadata for comic idx, or the latest comic if idx
+// is 0. Cancelling ctx aborts an in-flight request immediately, rather
+// than leaving it to run out the clock on httpClient's timeout.
+func getComic(ctx context.Context, idx int) (Comic, error) {
+	var cNum string
+
+	if idx == 0 {
+		cNum = ""
+	} else {
+		cNum = strconv.Itoa(idx)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, xkcdURL+cNum+"/"+xkcdSuffix, nil)
+	if err != nil {
+		return Comic{}, fmt.Errorf("unable to build request for xkcd info: %s", err)
+	}
+
+	resp, err := httpClient.Do(req)
+
+	if err != nil {
+		return Comic{}, fmt.Errorf("could not get xkcd info from remote")
+	} else if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return Comic{}, fmt.Errorf("error in request to xcd: %s", resp.Status)
+	}
+
+	var current Comic
+
+	if err := json.NewDecoder(resp.Body).Decode(&current); err != nil {
+		return Comic{}, fmt.Errorf("unable to decode json value from xkcd: %s", err)
+	}
+
+	current.PublishDate = publishDate(current)
+
+	return current, nil
+}
+
+// indexComic records cmc in the in-memory cache and persists it to the
+// backing store, unless it's already present.
+func (ix *Index) indexComic(cmc Comic) {
+	cNum := strconv.Itoa(cmc.Num)
+
+	ix.mu.Lock()
+	_, present := ix.idx[cNum]
+	if !present {
+		ix.idx[cNum] = cmc
+	}
+	ix.mu.Unlock()
+
+	if present {
+		return
+	}
+
+	log.Printf("Indexed comic %v:", cNum)
+	if err := ix.store.Put(cmc); err != nil {
+		log.Printf("Unable to persist comic %v: %s", cNum, err)
+	}
+}
+
+// has reports whether cNum is already present in the index.
+func (ix *Index) has(cNum string) bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	_, present := ix.idx[cNum]
+	return present
+}